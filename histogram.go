@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/bits"
+)
+
+const (
+	// histogramSubBuckets gives ~3 significant decimal digits of
+	// resolution within each power-of-two bucket (2048 == 2^11).
+	histogramSubBuckets = 2048
+	histogramSubBits    = 11
+	histogramMask       = histogramSubBuckets - 1
+)
+
+// Histogram is a logarithmic-bucket latency histogram in the HdrHistogram
+// tradition: O(1) RecordValue and a fixed, small memory footprint
+// regardless of how many values are recorded, unlike a slice of every
+// latency that has to be sorted to read percentiles. Values are tracked in whatever unit the
+// caller chooses to record in (tenchmark uses microseconds throughout).
+type Histogram struct {
+	lowestTrackable  int64
+	highestTrackable int64
+	counts           []int64
+	totalCount       int64
+	min, max         int64
+}
+
+func bucketExponent(v int64) int {
+	if v < 1 {
+		v = 1
+	}
+	return bits.Len64(uint64(v)) - 1
+}
+
+// bucketIndex maps v to a bucket: floor(log2(v)) buckets of
+// histogramSubBuckets sub-buckets each, with the sub-bucket selected by the
+// top histogramSubBits bits of v within its power-of-two range.
+func bucketIndex(v int64) int {
+	if v < 1 {
+		v = 1
+	}
+	exp := bucketExponent(v)
+	shift := exp - histogramSubBits
+	var sub int64
+	if shift >= 0 {
+		sub = (v >> uint(shift)) & histogramMask
+	} else {
+		sub = (v << uint(-shift)) & histogramMask
+	}
+	return exp*histogramSubBuckets + int(sub)
+}
+
+// valueForBucketIndex returns the (quantized) lower bound of the value
+// range that bucketIndex maps to idx.
+func valueForBucketIndex(idx int) int64 {
+	exp := idx / histogramSubBuckets
+	sub := int64(idx%histogramSubBuckets) + histogramSubBuckets
+	shift := exp - histogramSubBits
+	if shift >= 0 {
+		return sub << uint(shift)
+	}
+	return sub >> uint(-shift)
+}
+
+// NewHistogram builds a Histogram covering [lowest, highest] (in the
+// caller's unit), clamping out-of-range values rather than growing.
+func NewHistogram(lowest, highest int64) *Histogram {
+	buckets := bucketExponent(highest) + 1
+	return &Histogram{
+		lowestTrackable:  lowest,
+		highestTrackable: highest,
+		counts:           make([]int64, buckets*histogramSubBuckets),
+		min:              highest,
+		max:              lowest,
+	}
+}
+
+func (h *Histogram) RecordValue(v int64) {
+	if v < h.lowestTrackable {
+		v = h.lowestTrackable
+	}
+	if v > h.highestTrackable {
+		v = h.highestTrackable
+	}
+
+	idx := bucketIndex(v)
+	if idx >= len(h.counts) {
+		idx = len(h.counts) - 1
+	}
+	h.counts[idx]++
+	h.totalCount++
+
+	if v < h.min {
+		h.min = v
+	}
+	if v > h.max {
+		h.max = v
+	}
+}
+
+// Merge folds other's counts into h, so per-worker histograms can be
+// combined without ever sharing a channel.
+func (h *Histogram) Merge(other *Histogram) {
+	if other.totalCount == 0 {
+		return
+	}
+	for i, c := range other.counts {
+		h.counts[i] += c
+	}
+	h.totalCount += other.totalCount
+	if other.min < h.min {
+		h.min = other.min
+	}
+	if other.max > h.max {
+		h.max = other.max
+	}
+}
+
+func (h *Histogram) TotalCount() int64 {
+	return h.totalCount
+}
+
+// ValueAtPercentile returns the quantized lower bound of the bucket holding
+// the value of rank floor(p/100 * TotalCount()) (at least rank 1) in sorted
+// order (0 < p <= 100).
+func (h *Histogram) ValueAtPercentile(p float64) int64 {
+	if h.totalCount == 0 {
+		return 0
+	}
+
+	target := int64((p / 100) * float64(h.totalCount))
+	if target < 1 {
+		target = 1
+	}
+
+	var cum int64
+	for idx, c := range h.counts {
+		if c == 0 {
+			continue
+		}
+		cum += c
+		if cum >= target {
+			return valueForBucketIndex(idx)
+		}
+	}
+	return h.max
+}
+
+// WriteHgrm dumps one "value count" line per populated bucket, for offline
+// analysis with external HdrHistogram tooling.
+func (h *Histogram) WriteHgrm(w io.Writer) error {
+	if _, err := fmt.Fprintln(w, "# value\tcount"); err != nil {
+		return err
+	}
+	for idx, c := range h.counts {
+		if c == 0 {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "%d\t%d\n", valueForBucketIndex(idx), c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+
+	. "github.com/stdrickforce/thriftgo/transport"
+)
+
+// httpTransport implements Transport over a single Thrift-over-HTTP POST
+// request/response cycle, similar to Apache Thrift's THttpClient but trimmed
+// down to what tenchmark needs: a write buffer that is POSTed on Flush and a
+// response body that is read back.
+type httpTransport struct {
+	url    string
+	client *http.Client
+	wbuf   bytes.Buffer
+	rbuf   bytes.Buffer
+}
+
+func newHttpTransport(addr, path string) *httpTransport {
+	return &httpTransport{
+		url:    fmt.Sprintf("http://%s%s", addr, path),
+		client: &http.Client{},
+	}
+}
+
+func (t *httpTransport) Open() error {
+	return nil
+}
+
+func (t *httpTransport) IsOpen() bool {
+	return true
+}
+
+func (t *httpTransport) Close() error {
+	return nil
+}
+
+func (t *httpTransport) Read(buf []byte) (int, error) {
+	return t.rbuf.Read(buf)
+}
+
+func (t *httpTransport) Write(buf []byte) (int, error) {
+	return t.wbuf.Write(buf)
+}
+
+func (t *httpTransport) Flush() error {
+	req, err := http.NewRequest("POST", t.url, bytes.NewReader(t.wbuf.Bytes()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-thrift")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	t.wbuf.Reset()
+	t.rbuf.Reset()
+	_, err = io.Copy(&t.rbuf, resp.Body)
+	return err
+}
+
+type httpTransportFactory struct {
+	addr string
+	path string
+}
+
+// NewTHttpTransportFactory builds transports that speak Thrift-over-HTTP,
+// POSTing each request to http://addr+path with a
+// "Content-Type: application/x-thrift" header.
+func NewTHttpTransportFactory(addr, path string) TransportFactory {
+	return &httpTransportFactory{addr: addr, path: path}
+}
+
+func (f *httpTransportFactory) GetTransport() Transport {
+	return newHttpTransport(f.addr, f.path)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	. "github.com/stdrickforce/thriftgo/protocol"
+	. "github.com/stdrickforce/thriftgo/transport"
+)
+
+// arrival is one scheduled open-loop send: the wall-clock time it was
+// *supposed* to go out at, and the method picked for it.
+type arrival struct {
+	intended time.Time
+	name     string
+	kase     Case
+}
+
+// poissonOffsets generates count inter-arrival gaps drawn from an
+// exponential distribution (i.e. a Poisson arrival process) with the given
+// mean rate, returned as cumulative offsets from t=0.
+func poissonOffsets(rate float64, count int) []time.Duration {
+	offsets := make([]time.Duration, count)
+	var t float64
+	for i := range offsets {
+		t += rand.ExpFloat64() / rate
+		offsets[i] = time.Duration(t * float64(time.Second))
+	}
+	return offsets
+}
+
+// uniformOffsets generates count evenly spaced offsets at the given rate.
+func uniformOffsets(rate float64, count int) []time.Duration {
+	interval := time.Duration(float64(time.Second) / rate)
+	offsets := make([]time.Duration, count)
+	for i := range offsets {
+		offsets[i] = time.Duration(i) * interval
+	}
+	return offsets
+}
+
+// offsetsForDuration keeps drawing inter-arrival gaps (Poisson or uniform,
+// at the given rate) until dur is exceeded, used when --duration replaces
+// -n as the stopping condition.
+func offsetsForDuration(rate float64, dur time.Duration, poisson bool) []time.Duration {
+	var (
+		offsets []time.Duration
+		t       float64
+	)
+	for {
+		if poisson {
+			t += rand.ExpFloat64() / rate
+		} else {
+			t += 1 / rate
+		}
+		d := time.Duration(t * float64(time.Second))
+		if d > dur {
+			return offsets
+		}
+		offsets = append(offsets, d)
+	}
+}
+
+// dispatch sleeps until each offset elapses relative to start, then hands
+// the picked call off to jobs tagged with its intended send time. Workers
+// pulling from jobs may be busy, in which case the actual send lags behind
+// intended — that gap is coordinated omission, and is exactly what the
+// response-time histogram captures that the service-time histogram does not.
+func dispatch(sc *Scenario, start time.Time, offsets []time.Duration, jobs chan<- arrival) {
+	defer close(jobs)
+	for _, offset := range offsets {
+		target := start.Add(offset)
+		if d := time.Until(target); d > 0 {
+			time.Sleep(d)
+		}
+		name, kase := sc.Pick()
+		jobs <- arrival{intended: target, name: name, kase: kase}
+	}
+}
+
+// openLoopProcess is the open-loop counterpart to Processor.process: rather
+// than looping a fixed count, it drains scheduled arrivals from jobs until
+// dispatch closes the channel.
+func (p *Processor) openLoopProcess(gid int, jobs <-chan arrival) {
+	defer wg.Done()
+
+	var (
+		trans Transport
+		proto Protocol
+	)
+
+	trans = p.tf.GetTransport()
+	trans = p.tw.GetTransport(trans)
+	proto = p.pf.GetProtocol(trans)
+
+	if p.service != "" {
+		proto = NewMultiplexedProtocol(proto, p.service)
+	}
+
+	if err := trans.Open(); err != nil {
+		panic(err)
+	}
+	defer trans.Close()
+
+	st := newStats()
+	p.workers[gid] = st
+
+	locker, shared := trans.(transportLocker)
+
+	for a := range jobs {
+		if shared {
+			locker.Lock()
+		}
+		p.live.begin()
+		actual := time.Now()
+		err := a.kase(proto)
+		done := time.Now()
+		p.live.end()
+		if shared {
+			locker.Unlock()
+		}
+
+		if err != nil {
+			p.live.recordError()
+			fmt.Println(a.name, err)
+			return
+		}
+
+		serviceMicros := int64(done.Sub(actual).Microseconds())
+		st.record(a.name, serviceMicros, int64(done.Sub(a.intended).Microseconds()))
+		p.live.record(serviceMicros)
+	}
+}
@@ -1,9 +1,8 @@
 package main
 
 import (
-	"errors"
 	"fmt"
-	"math"
+	"os"
 	"runtime"
 	"sync"
 	"time"
@@ -20,30 +19,13 @@ var (
 	wg sync.WaitGroup
 )
 
-func call(name string, args ...interface{}) Case {
+func call(name string, args ...TypedValue) Case {
 	var writeMessageBody = func(proto Protocol) (err error) {
 		if err = proto.WriteStructBegin("whatever"); err != nil {
 			return
 		}
 		for i, arg := range args {
-			index := int16(i + 1)
-			switch v := arg.(type) {
-			case int16:
-				err = proto.WriteFieldBegin("i16", T_I16, index)
-				err = proto.WriteI16(v)
-			case int32:
-				err = proto.WriteFieldBegin("i32", T_I32, index)
-				err = proto.WriteI32(v)
-			case int64:
-				err = proto.WriteFieldBegin("i64", T_I64, index)
-				err = proto.WriteI64(v)
-			case string:
-				err = proto.WriteFieldBegin("string", T_STRING, index)
-				err = proto.WriteString(v)
-			default:
-				err = errors.New("unsupport type")
-			}
-			if err != nil {
+			if err = writeField(proto, int16(i+1), arg); err != nil {
 				return
 			}
 		}
@@ -87,8 +69,9 @@ type Processor struct {
 	pf      ProtocolFactory
 	tf      TransportFactory
 	tw      TransportWrapper
-	fn      Case
-	ch      chan int
+	fn      *Scenario
+	workers []*stats
+	live    *progress
 }
 
 func (p *Processor) process(gid, count int) {
@@ -112,84 +95,35 @@ func (p *Processor) process(gid, count int) {
 	}
 	defer trans.Close()
 
-	for i := 0; i < count; i++ {
-		snano := time.Now().UnixNano()
-		if err := p.fn(proto); err != nil {
-			fmt.Println(gid, err)
-			return
-		}
-		duration := time.Now().UnixNano() - snano
-		p.ch <- int(duration / 1000)
-	}
-}
+	st := newStats()
+	p.workers[gid] = st
 
-func sort(values []int, l, r int) {
-	if l >= r {
-		return
-	}
+	locker, shared := trans.(transportLocker)
 
-	pivot := values[l]
-	i := l + 1
+	for i := 0; i < count; i++ {
+		name, kase := p.fn.Pick()
 
-	for j := l + 1; j <= r; j++ {
-		if pivot > values[j] {
-			values[i], values[j] = values[j], values[i]
-			i++
+		if shared {
+			locker.Lock()
 		}
-	}
-
-	values[l], values[i-1] = values[i-1], pivot
-
-	sort(values, l, i-2)
-	sort(values, i, r)
-}
-
-func collect(processor *Processor, pipe chan<- string) {
-	defer close(pipe)
-
-	snano := time.Now().UnixNano()
-
-	var s = make([]int, 0)
-	for duration := range processor.ch {
-		s = append(s, duration)
-	}
-
-	dnano := time.Now().UnixNano() - snano
-
-	l := len(s)
-	sort(s, 0, l-1)
-
-	v := func(denominator int) float64 {
-		if denominator <= 0 {
-			return float64(s[l-1]) / 1000
-		} else {
-			return float64(s[l*(denominator-1)/denominator-1]) / 1000
+		p.live.begin()
+		snano := time.Now().UnixNano()
+		err := kase(proto)
+		micros := int64(time.Now().UnixNano()-snano) / 1000
+		p.live.end()
+		if shared {
+			locker.Unlock()
 		}
-	}
 
-	var (
-		duration = float64(dnano) / math.Pow(10, 9)
-		qps      = float64(l) / duration
-	)
+		if err != nil {
+			p.live.recordError()
+			fmt.Println(gid, err)
+			return
+		}
 
-	pipe <- fmt.Sprintf("%-24s%s", "Server Address:", *addr)
-	pipe <- ""
-	pipe <- fmt.Sprintf("%-24s%d", "Concurrency level:", *concurrency)
-	pipe <- fmt.Sprintf("%-24s%.3f seconds", "Time taken for tests:", duration)
-	pipe <- fmt.Sprintf("%-24s%d", "Complete requests:", l)
-	pipe <- fmt.Sprintf("%-24s%d", "Failed requests:", *requests-l)
-	pipe <- fmt.Sprintf("%-24s%.2f [#/sec] (mean)", "Request per second:", qps)
-	pipe <- ""
-	pipe <- "Percentage of the requests served within a certain time (ms)"
-	pipe <- fmt.Sprintf("%4d%% %8.2f", 50, v(2))
-	pipe <- fmt.Sprintf("%4d%% %8.2f", 66, v(3))
-	pipe <- fmt.Sprintf("%4d%% %8.2f", 75, v(4))
-	pipe <- fmt.Sprintf("%4d%% %8.2f", 80, v(5))
-	pipe <- fmt.Sprintf("%4d%% %8.2f", 90, v(10))
-	pipe <- fmt.Sprintf("%4d%% %8.2f", 95, v(20))
-	pipe <- fmt.Sprintf("%4d%% %8.2f", 98, v(50))
-	pipe <- fmt.Sprintf("%4d%% %8.2f", 99, v(100))
-	pipe <- fmt.Sprintf("%4d%% %8.2f (longest request)", 100, v(-1))
+		st.record(name, micros, micros)
+		p.live.record(micros)
+	}
 }
 
 var (
@@ -200,6 +134,26 @@ var (
 	transport         = kingpin.Flag("transport", "Specify transport factory").Default("socket").String()
 	transport_wrapper = kingpin.Flag("transport-wrapper", "Specify transport wrapper").Default("buffered").String()
 	service           = kingpin.Flag("service", "Specify service name").String()
+	scenario          = kingpin.Flag("scenario", "Scenario file (.yaml/.json) describing weighted method calls").String()
+	rate              = kingpin.Flag("rate", "Target requests/sec (global); enables open-loop load generation").Default("0").Float64()
+	runDuration       = kingpin.Flag("duration", "Run duration (e.g. 30s), used instead of -n in open-loop mode").Duration()
+	arrivalProcess    = kingpin.Flag("arrival", "Open-loop arrival process: poisson or uniform").Default("poisson").Enum("poisson", "uniform")
+	outputHgrm        = kingpin.Flag("output-hgrm", "Dump the merged response-time histogram to file for offline analysis").String()
+	interval          = kingpin.Flag("interval", "Live progress print interval").Default("1s").Duration()
+	quiet             = kingpin.Flag("quiet", "Suppress live progress output").Bool()
+	jsonProgress      = kingpin.Flag("json-progress", "Emit live progress as newline-delimited JSON instead of text").Bool()
+	outputFormat      = kingpin.Flag("output-format", "Result output format").Default("text").Enum("text", "json", "csv")
+	outputFile        = kingpin.Flag("output-file", "Write results to file instead of stdout").String()
+	sloP99            = kingpin.Flag("slo-p99", "Fail (non-zero exit) if p99 latency exceeds this, e.g. 50ms").String()
+	sloErrorRate      = kingpin.Flag("slo-error-rate", "Fail (non-zero exit) if the error rate exceeds this percentage, e.g. 0.1%").String()
+	tlsEnabled        = kingpin.Flag("tls", "Wrap the connection in TLS").Bool()
+	tlsCert           = kingpin.Flag("tls-cert", "Client certificate file (PEM)").String()
+	tlsKey            = kingpin.Flag("tls-key", "Client key file (PEM)").String()
+	tlsCA             = kingpin.Flag("tls-ca", "CA bundle to verify the server certificate against (PEM)").String()
+	tlsInsecure       = kingpin.Flag("tls-insecure", "Skip server certificate verification").Bool()
+	tlsServerName     = kingpin.Flag("tls-servername", "Override the server name used for certificate verification").String()
+	keepalive         = kingpin.Flag("keepalive", "TCP keepalive interval for --tls connections (0 disables)").Default("30s").Duration()
+	connections       = kingpin.Flag("connections", "Physical connections shared across --concurrency workers (0 = one per worker)").Default("0").Int()
 
 	addr = kingpin.Arg("addr", "Server addr").Default(":6000").String()
 )
@@ -229,34 +183,94 @@ func main() {
 		panic("Invalid number of requests")
 	}
 
+	var sc *Scenario
+	if *scenario != "" {
+		var err error
+		if sc, err = LoadScenario(*scenario); err != nil {
+			panic(err)
+		}
+	} else {
+		sc = NewSingleScenario("ping")
+	}
+
+	var tf TransportFactory
+	if *tlsEnabled {
+		tf = NewTTLSSocketFactory(*addr, buildTLSConfig(), *keepalive)
+	} else {
+		tf = Transports.Get(*transport, *addr)
+	}
+
+	tw := get_transport_wrapper(*transport_wrapper)
+	if *connections > 0 {
+		tf = NewPooledTransportFactory(tf, tw, *connections)
+		tw = TTransportWrapper
+	}
+
 	var processor = &Processor{
-		pf:      NewTBinaryProtocolFactory(true, true),
-		tf:      NewTSocketFactory(*addr),
-		tw:      get_transport_wrapper(*transport_wrapper),
-		fn:      call("ping"),
-		ch:      make(chan int, *concurrency*2),
+		pf:      Protocols.Get(*protocol),
+		tf:      tf,
+		tw:      tw,
+		fn:      sc,
+		workers: make([]*stats, *concurrency),
+		live:    newProgress(),
 		service: *service,
 	}
 
-	var pipe = make(chan string)
-	go collect(processor, pipe)
-
 	fmt.Printf("Benchmarking %v (be patient)......\n\n", *addr)
 
-	quotient, remainder := *requests / *concurrency, *requests%*concurrency
-	for i := 0; i < *concurrency; i++ {
-		if i < remainder {
-			go processor.process(i, quotient+1)
+	start := time.Now()
+
+	done := make(chan struct{})
+	if !*quiet {
+		go processor.live.watch(*interval, *jsonProgress, done)
+	}
+
+	attempted := int64(*requests)
+
+	if *rate > 0 {
+		poisson := *arrivalProcess == "poisson"
+
+		var offsets []time.Duration
+		if *runDuration > 0 {
+			offsets = offsetsForDuration(*rate, *runDuration, poisson)
+		} else if poisson {
+			offsets = poissonOffsets(*rate, *requests)
 		} else {
-			go processor.process(i, quotient)
+			offsets = uniformOffsets(*rate, *requests)
+		}
+		attempted = int64(len(offsets))
+
+		jobs := make(chan arrival, *concurrency)
+		for i := 0; i < *concurrency; i++ {
+			go processor.openLoopProcess(i, jobs)
+			wg.Add(1)
 		}
-		wg.Add(1)
+		go dispatch(sc, start, offsets, jobs)
+		wg.Wait()
+	} else {
+		quotient, remainder := *requests / *concurrency, *requests%*concurrency
+		for i := 0; i < *concurrency; i++ {
+			if i < remainder {
+				go processor.process(i, quotient+1)
+			} else {
+				go processor.process(i, quotient)
+			}
+			wg.Add(1)
+		}
+		wg.Wait()
 	}
-	wg.Wait()
 
-	close(processor.ch)
+	close(done)
+	end := time.Now()
+
+	merged := newStats()
+	for _, st := range processor.workers {
+		if st != nil {
+			merged.merge(st)
+		}
+	}
 
-	for line := range pipe {
-		fmt.Println(line)
+	if report(merged, attempted, start, end) {
+		os.Exit(1)
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+
+	. "github.com/stdrickforce/thriftgo/transport"
+)
+
+// pooledConn is one physical connection shared by however many workers
+// round-robin onto it. Open is idempotent (the first worker to reach it
+// dials; later ones are no-ops) and Close is a no-op, since the pool -- not
+// any one worker -- owns the connection's lifetime. Callers must take
+// pooledConn's own lock for the duration of a call to avoid interleaving
+// Thrift frames from two workers on the wire.
+type pooledConn struct {
+	mu     sync.Mutex
+	trans  Transport
+	opened bool
+}
+
+func (c *pooledConn) Lock()   { c.mu.Lock() }
+func (c *pooledConn) Unlock() { c.mu.Unlock() }
+
+func (c *pooledConn) Open() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.opened {
+		return nil
+	}
+	if err := c.trans.Open(); err != nil {
+		return err
+	}
+	c.opened = true
+	return nil
+}
+
+func (c *pooledConn) IsOpen() bool {
+	return c.trans.IsOpen()
+}
+
+func (c *pooledConn) Close() error {
+	return nil
+}
+
+func (c *pooledConn) Read(p []byte) (int, error) {
+	return c.trans.Read(p)
+}
+
+func (c *pooledConn) Write(p []byte) (int, error) {
+	return c.trans.Write(p)
+}
+
+func (c *pooledConn) Flush() error {
+	return c.trans.Flush()
+}
+
+// PooledTransportFactory hands out one of a small, fixed set of physical
+// connections round-robin, decoupling connection count from worker
+// goroutine count -- the real-world case where many in-flight calls share
+// a small client pool instead of one connection per goroutine.
+type PooledTransportFactory struct {
+	conns []*pooledConn
+	next  uint64
+}
+
+// NewPooledTransportFactory pre-wraps size physical connections from inner
+// with tw (buffered/framed, as configured by --transport-wrapper), to be
+// checked out round-robin by GetTransport.
+func NewPooledTransportFactory(inner TransportFactory, tw TransportWrapper, size int) *PooledTransportFactory {
+	conns := make([]*pooledConn, size)
+	for i := range conns {
+		conns[i] = &pooledConn{trans: tw.GetTransport(inner.GetTransport())}
+	}
+	return &PooledTransportFactory{conns: conns}
+}
+
+func (f *PooledTransportFactory) GetTransport() Transport {
+	i := atomic.AddUint64(&f.next, 1) - 1
+	return f.conns[i%uint64(len(f.conns))]
+}
+
+// transportLocker is implemented by Transports that may be shared between
+// workers (currently just pooledConn); callers must hold it for the
+// duration of a call.
+type transportLocker interface {
+	Lock()
+	Unlock()
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// progress tracks live stats shared across every worker: an atomic
+// in-flight counter plus a mutex-protected rolling histogram that's reset
+// on every print tick, so watch can report an instantaneous p50/p99
+// instead of a running average.
+type progress struct {
+	inflight  int64
+	completed int64
+	errors    int64
+
+	mu     sync.Mutex
+	window *Histogram
+}
+
+func newProgress() *progress {
+	return &progress{window: NewHistogram(microsLow, microsHigh)}
+}
+
+func (pr *progress) begin() {
+	atomic.AddInt64(&pr.inflight, 1)
+}
+
+func (pr *progress) end() {
+	atomic.AddInt64(&pr.inflight, -1)
+}
+
+func (pr *progress) recordError() {
+	atomic.AddInt64(&pr.errors, 1)
+}
+
+func (pr *progress) record(micros int64) {
+	atomic.AddInt64(&pr.completed, 1)
+
+	pr.mu.Lock()
+	pr.window.RecordValue(micros)
+	pr.mu.Unlock()
+}
+
+// snapshot returns the histogram accumulated since the last snapshot and
+// starts a fresh one for the next interval.
+func (pr *progress) snapshot() *Histogram {
+	pr.mu.Lock()
+	h := pr.window
+	pr.window = NewHistogram(microsLow, microsHigh)
+	pr.mu.Unlock()
+	return h
+}
+
+// watch prints one progress line every interval until done is closed.
+func (pr *progress) watch(interval time.Duration, jsonOut bool, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastCompleted int64
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			completed := atomic.LoadInt64(&pr.completed)
+			qps := float64(completed-lastCompleted) / interval.Seconds()
+			lastCompleted = completed
+
+			pr.printTick(qps, atomic.LoadInt64(&pr.inflight), atomic.LoadInt64(&pr.errors), pr.snapshot(), jsonOut)
+		}
+	}
+}
+
+func (pr *progress) printTick(qps float64, inflight, errs int64, window *Histogram, jsonOut bool) {
+	p50 := float64(window.ValueAtPercentile(50)) / 1000
+	p99 := float64(window.ValueAtPercentile(99)) / 1000
+
+	if jsonOut {
+		line, _ := json.Marshal(map[string]interface{}{
+			"qps":      qps,
+			"inflight": inflight,
+			"errors":   errs,
+			"p50_ms":   p50,
+			"p99_ms":   p99,
+		})
+		fmt.Println(string(line))
+		return
+	}
+
+	fmt.Printf("[%s] qps=%.1f inflight=%d errors=%d p50=%.2fms p99=%.2fms\n",
+		time.Now().Format("15:04:05"), qps, inflight, errs, p50, p99)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	. "github.com/stdrickforce/thriftgo/protocol"
+	. "github.com/stdrickforce/thriftgo/transport"
+)
+
+// ProtocolFactoryFunc builds a ProtocolFactory on demand. Implementations
+// should be cheap and side-effect free; the factory itself is reused across
+// every worker goroutine.
+type ProtocolFactoryFunc func() ProtocolFactory
+
+// TransportFactoryFunc builds a TransportFactory bound to addr. It is called
+// once per run; each worker then gets its own Transport from the returned
+// factory.
+type TransportFactoryFunc func(addr string) TransportFactory
+
+// ProtocolRegistry maps protocol names (as passed to --protocol) to the
+// factories that construct them.
+type ProtocolRegistry struct {
+	factories map[string]ProtocolFactoryFunc
+}
+
+func NewProtocolRegistry() *ProtocolRegistry {
+	return &ProtocolRegistry{factories: make(map[string]ProtocolFactoryFunc)}
+}
+
+// Register adds or overrides the factory for name, so custom protocols can
+// be plugged in next to the built-in ones.
+func (r *ProtocolRegistry) Register(name string, factory ProtocolFactoryFunc) {
+	r.factories[name] = factory
+}
+
+func (r *ProtocolRegistry) Get(name string) ProtocolFactory {
+	factory, ok := r.factories[name]
+	if !ok {
+		panic("unknown protocol: " + name)
+	}
+	return factory()
+}
+
+// TransportRegistry maps transport names (as passed to --transport) to the
+// factories that construct them.
+type TransportRegistry struct {
+	factories map[string]TransportFactoryFunc
+}
+
+func NewTransportRegistry() *TransportRegistry {
+	return &TransportRegistry{factories: make(map[string]TransportFactoryFunc)}
+}
+
+// Register adds or overrides the factory for name, so custom transports can
+// be plugged in next to the built-in ones.
+func (r *TransportRegistry) Register(name string, factory TransportFactoryFunc) {
+	r.factories[name] = factory
+}
+
+func (r *TransportRegistry) Get(name, addr string) TransportFactory {
+	factory, ok := r.factories[name]
+	if !ok {
+		panic("unknown transport: " + name)
+	}
+	return factory(addr)
+}
+
+var (
+	Protocols  = NewProtocolRegistry()
+	Transports = NewTransportRegistry()
+)
+
+func init() {
+	Protocols.Register("binary", func() ProtocolFactory {
+		return NewTBinaryProtocolFactory(true, true)
+	})
+	Protocols.Register("compact", func() ProtocolFactory {
+		return NewTCompactProtocolFactory()
+	})
+	Protocols.Register("json", func() ProtocolFactory {
+		return NewTJSONProtocolFactory()
+	})
+
+	Transports.Register("socket", func(addr string) TransportFactory {
+		return NewTSocketFactory(addr)
+	})
+	Transports.Register("unix", func(addr string) TransportFactory {
+		return NewTUnixSocketFactory(addr)
+	})
+	Transports.Register("http", func(addr string) TransportFactory {
+		return NewTHttpTransportFactory(addr, *path)
+	})
+}
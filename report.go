@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Percentiles is the standard ab-style percentile table, in milliseconds.
+type Percentiles struct {
+	P50, P66, P75, P80, P90, P95, P98, P99, P100 float64
+}
+
+func percentilesFromHistogram(h *Histogram) Percentiles {
+	ms := func(p float64) float64 { return float64(h.ValueAtPercentile(p)) / 1000 }
+	return Percentiles{
+		P50: ms(50), P66: ms(66), P75: ms(75), P80: ms(80),
+		P90: ms(90), P95: ms(95), P98: ms(98), P99: ms(99),
+		P100: float64(h.max) / 1000,
+	}
+}
+
+type MethodReport struct {
+	Name        string      `json:"name"`
+	Requests    int64       `json:"requests"`
+	Percentiles Percentiles `json:"percentiles_ms"`
+}
+
+// Report is the full structured result of a run, used as-is for
+// --output-format=json and flattened for text/csv.
+type Report struct {
+	Addr        string         `json:"addr"`
+	Protocol    string         `json:"protocol"`
+	Transport   string         `json:"transport"`
+	Concurrency int            `json:"concurrency"`
+	StartTime   time.Time      `json:"start_time"`
+	EndTime     time.Time      `json:"end_time"`
+	DurationSec float64        `json:"duration_seconds"`
+	Completed   int64          `json:"completed"`
+	Failed      int64          `json:"failed"`
+	QPS         float64        `json:"qps"`
+	OpenLoop    bool           `json:"open_loop"`
+	Service     Percentiles    `json:"service_percentiles_ms"`
+	Response    *Percentiles   `json:"response_percentiles_ms,omitempty"`
+	Methods     []MethodReport `json:"methods,omitempty"`
+}
+
+// buildReport turns st into a Report. attempted is the number of requests
+// the run actually intended to make -- *requests in closed-loop mode, but
+// the number of scheduled arrivals in open-loop --duration mode, where
+// *requests stays at its default and can't be used to derive Failed.
+func buildReport(st *stats, attempted int64, start, end time.Time) *Report {
+	duration := end.Sub(start).Seconds()
+
+	r := &Report{
+		Addr:        *addr,
+		Protocol:    *protocol,
+		Transport:   *transport,
+		Concurrency: *concurrency,
+		StartTime:   start,
+		EndTime:     end,
+		DurationSec: duration,
+		Completed:   st.count,
+		Failed:      attempted - st.count,
+		QPS:         float64(st.count) / duration,
+		OpenLoop:    *rate > 0,
+		Service:     percentilesFromHistogram(st.service),
+	}
+
+	if r.OpenLoop {
+		response := percentilesFromHistogram(st.response)
+		r.Response = &response
+	}
+
+	if len(st.methodOrder) > 1 {
+		for _, name := range st.methodOrder {
+			h := st.byMethod[name]
+			r.Methods = append(r.Methods, MethodReport{
+				Name:        name,
+				Requests:    h.TotalCount(),
+				Percentiles: percentilesFromHistogram(h),
+			})
+		}
+	}
+
+	return r
+}
+
+func printPercentilesText(w io.Writer, title string, p Percentiles) {
+	fmt.Fprintln(w, title)
+	fmt.Fprintf(w, "%4d%% %8.2f\n", 50, p.P50)
+	fmt.Fprintf(w, "%4d%% %8.2f\n", 66, p.P66)
+	fmt.Fprintf(w, "%4d%% %8.2f\n", 75, p.P75)
+	fmt.Fprintf(w, "%4d%% %8.2f\n", 80, p.P80)
+	fmt.Fprintf(w, "%4d%% %8.2f\n", 90, p.P90)
+	fmt.Fprintf(w, "%4d%% %8.2f\n", 95, p.P95)
+	fmt.Fprintf(w, "%4d%% %8.2f\n", 98, p.P98)
+	fmt.Fprintf(w, "%4d%% %8.2f\n", 99, p.P99)
+	fmt.Fprintf(w, "%4d%% %8.2f (longest request)\n", 100, p.P100)
+}
+
+func (r *Report) writeText(w io.Writer) {
+	fmt.Fprintf(w, "%-24s%s\n", "Server Address:", r.Addr)
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "%-24s%d\n", "Concurrency level:", r.Concurrency)
+	fmt.Fprintf(w, "%-24s%.3f seconds\n", "Time taken for tests:", r.DurationSec)
+	fmt.Fprintf(w, "%-24s%d\n", "Complete requests:", r.Completed)
+	fmt.Fprintf(w, "%-24s%d\n", "Failed requests:", r.Failed)
+	fmt.Fprintf(w, "%-24s%.2f [#/sec] (mean)\n", "Request per second:", r.QPS)
+	fmt.Fprintln(w)
+
+	if r.Response != nil {
+		printPercentilesText(w, "Response time (ms) -- coordinated-omission corrected", *r.Response)
+		fmt.Fprintln(w)
+		printPercentilesText(w, "Service time (ms)", r.Service)
+	} else {
+		printPercentilesText(w, "Percentage of the requests served within a certain time (ms)", r.Service)
+	}
+
+	for _, m := range r.Methods {
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "Method %q (%d requests)\n", m.Name, m.Requests)
+		printPercentilesText(w, "Percentage of the requests served within a certain time (ms)", m.Percentiles)
+	}
+}
+
+func (r *Report) writeJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+func (r *Report) writeCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	defer cw.Flush()
+
+	header := []string{"method", "requests", "p50_ms", "p66_ms", "p75_ms", "p80_ms", "p90_ms", "p95_ms", "p98_ms", "p99_ms", "p100_ms"}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	row := func(name string, count int64, p Percentiles) []string {
+		f := func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+		return []string{name, strconv.FormatInt(count, 10), f(p.P50), f(p.P66), f(p.P75), f(p.P80), f(p.P90), f(p.P95), f(p.P98), f(p.P99), f(p.P100)}
+	}
+
+	if err := cw.Write(row("__all__", r.Completed, r.Service)); err != nil {
+		return err
+	}
+	for _, m := range r.Methods {
+		if err := cw.Write(row(m.Name, m.Requests, m.Percentiles)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// report renders st as a Report in the configured --output-format, writes
+// it to --output-file (or stdout), dumps --output-hgrm if set, and returns
+// whether any --slo-* gate was violated (the caller should exit non-zero).
+// attempted is the number of requests the run intended to make; see
+// buildReport.
+func report(st *stats, attempted int64, start, end time.Time) bool {
+	r := buildReport(st, attempted, start, end)
+
+	w := io.Writer(os.Stdout)
+	if *outputFile != "" {
+		f, err := os.Create(*outputFile)
+		if err != nil {
+			panic(err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	var err error
+	switch *outputFormat {
+	case "json":
+		err = r.writeJSON(w)
+	case "csv":
+		err = r.writeCSV(w)
+	default:
+		r.writeText(w)
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	if *outputHgrm != "" {
+		f, err := os.Create(*outputHgrm)
+		if err != nil {
+			panic(err)
+		}
+		defer f.Close()
+
+		if err := st.response.WriteHgrm(f); err != nil {
+			panic(err)
+		}
+	}
+
+	return evaluateSLO(r)
+}
+
+// evaluateSLO checks --slo-p99/--slo-error-rate against r, printing any
+// violation to stderr and reporting whether the run should fail the build.
+func evaluateSLO(r *Report) bool {
+	violated := false
+
+	if *sloP99 != "" {
+		limit, err := time.ParseDuration(*sloP99)
+		if err != nil {
+			panic(err)
+		}
+
+		p99 := r.Service.P99
+		if r.Response != nil {
+			p99 = r.Response.P99
+		}
+		if limitMs := float64(limit.Microseconds()) / 1000; p99 > limitMs {
+			fmt.Fprintf(os.Stderr, "SLO violated: p99 %.2fms exceeds %s\n", p99, *sloP99)
+			violated = true
+		}
+	}
+
+	if *sloErrorRate != "" {
+		limit, err := strconv.ParseFloat(strings.TrimSuffix(*sloErrorRate, "%"), 64)
+		if err != nil {
+			panic(err)
+		}
+
+		total := r.Completed + r.Failed
+		var errorRate float64
+		if total > 0 {
+			errorRate = float64(r.Failed) / float64(total) * 100
+		}
+		if errorRate > limit {
+			fmt.Fprintf(os.Stderr, "SLO violated: error rate %.3f%% exceeds %s\n", errorRate, *sloErrorRate)
+			violated = true
+		}
+	}
+
+	return violated
+}
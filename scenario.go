@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"time"
+
+	. "github.com/stdrickforce/thriftgo/protocol"
+	"gopkg.in/yaml.v2"
+)
+
+// TypedValue is one argument (or, recursively, one list element / map
+// key-value / struct field) in a scenario file. Type is one of: i16, i32,
+// i64, string, bool, double, binary, list, map, struct.
+type TypedValue struct {
+	Type     string       `yaml:"type" json:"type"`
+	Value    interface{}  `yaml:"value,omitempty" json:"value,omitempty"`
+	ElemType string       `yaml:"elem_type,omitempty" json:"elem_type,omitempty"`
+	KeyType  string       `yaml:"key_type,omitempty" json:"key_type,omitempty"`
+	ValType  string       `yaml:"val_type,omitempty" json:"val_type,omitempty"`
+	Fields   []TypedValue `yaml:"fields,omitempty" json:"fields,omitempty"`
+}
+
+func toInt64(v interface{}) int64 {
+	switch n := v.(type) {
+	case int64:
+		return n
+	case int:
+		return int64(n)
+	case float64:
+		return int64(n)
+	default:
+		panic(fmt.Sprintf("expected a number, got %T", v))
+	}
+}
+
+// toInterfaceMap normalizes a decoded "map" value to map[interface{}]interface{}.
+// yaml.v2 decodes YAML mappings that way directly, but encoding/json always
+// decodes JSON objects to map[string]interface{}, so a map-typed argument in
+// a .json scenario needs its keys widened before writeTypedValue can walk it.
+func toInterfaceMap(v interface{}) map[interface{}]interface{} {
+	switch m := v.(type) {
+	case map[interface{}]interface{}:
+		return m
+	case map[string]interface{}:
+		out := make(map[interface{}]interface{}, len(m))
+		for k, val := range m {
+			out[k] = val
+		}
+		return out
+	default:
+		panic(fmt.Sprintf("expected a map, got %T", v))
+	}
+}
+
+// writeTypedValue writes v's value, assuming any necessary field/list/map
+// header has already been written by the caller.
+func writeTypedValue(proto Protocol, v TypedValue) (err error) {
+	switch v.Type {
+	case "i16":
+		err = proto.WriteI16(int16(toInt64(v.Value)))
+	case "i32":
+		err = proto.WriteI32(int32(toInt64(v.Value)))
+	case "i64":
+		err = proto.WriteI64(toInt64(v.Value))
+	case "string":
+		err = proto.WriteString(v.Value.(string))
+	case "bool":
+		err = proto.WriteBool(v.Value.(bool))
+	case "double":
+		err = proto.WriteDouble(v.Value.(float64))
+	case "binary":
+		var raw []byte
+		if raw, err = base64.StdEncoding.DecodeString(v.Value.(string)); err != nil {
+			return
+		}
+		err = proto.WriteBinary(raw)
+	case "list":
+		elems := v.Value.([]interface{})
+		if err = proto.WriteListBegin(thriftType(v.ElemType), len(elems)); err != nil {
+			return
+		}
+		for _, e := range elems {
+			if err = writeTypedValue(proto, TypedValue{Type: v.ElemType, Value: e}); err != nil {
+				return
+			}
+		}
+		err = proto.WriteListEnd()
+	case "map":
+		entries := toInterfaceMap(v.Value)
+		if err = proto.WriteMapBegin(thriftType(v.KeyType), thriftType(v.ValType), len(entries)); err != nil {
+			return
+		}
+		for k, val := range entries {
+			if err = writeTypedValue(proto, TypedValue{Type: v.KeyType, Value: k}); err != nil {
+				return
+			}
+			if err = writeTypedValue(proto, TypedValue{Type: v.ValType, Value: val}); err != nil {
+				return
+			}
+		}
+		err = proto.WriteMapEnd()
+	case "struct":
+		if err = proto.WriteStructBegin("whatever"); err != nil {
+			return
+		}
+		for i, field := range v.Fields {
+			if err = writeField(proto, int16(i+1), field); err != nil {
+				return
+			}
+		}
+		if err = proto.WriteFieldStop(); err != nil {
+			return
+		}
+		err = proto.WriteStructEnd()
+	default:
+		err = fmt.Errorf("unsupported argument type: %s", v.Type)
+	}
+	return
+}
+
+func thriftType(name string) byte {
+	switch name {
+	case "i16":
+		return T_I16
+	case "i32":
+		return T_I32
+	case "i64":
+		return T_I64
+	case "string", "binary":
+		return T_STRING
+	case "bool":
+		return T_BOOL
+	case "double":
+		return T_DOUBLE
+	case "list":
+		return T_LIST
+	case "map":
+		return T_MAP
+	case "struct":
+		return T_STRUCT
+	default:
+		panic("unsupported argument type: " + name)
+	}
+}
+
+func writeField(proto Protocol, index int16, v TypedValue) (err error) {
+	if err = proto.WriteFieldBegin(v.Type, thriftType(v.Type), index); err != nil {
+		return
+	}
+	return writeTypedValue(proto, v)
+}
+
+// MethodCall is one scenario entry: a method name, its typed arguments, an
+// optional weight (default 1) controlling how often it's picked, and an
+// optional think-time to sleep before issuing the call.
+type MethodCall struct {
+	Name   string       `yaml:"name" json:"name"`
+	Args   []TypedValue `yaml:"args" json:"args"`
+	Weight int          `yaml:"weight" json:"weight"`
+	Think  string       `yaml:"think" json:"think"`
+}
+
+type scenarioEntry struct {
+	name   string
+	weight int
+	kase   Case
+}
+
+// Scenario dispatches to one of several Cases, weighted, so a single worker
+// loop can drive a realistic mix of method calls instead of a single
+// hardcoded RPC.
+type Scenario struct {
+	entries     []scenarioEntry
+	totalWeight int
+}
+
+// NewSingleScenario wraps a single call as a Scenario, used when no
+// --scenario file is given.
+func NewSingleScenario(name string, args ...TypedValue) *Scenario {
+	return &Scenario{
+		entries:     []scenarioEntry{{name: name, weight: 1, kase: call(name, args...)}},
+		totalWeight: 1,
+	}
+}
+
+// LoadScenario reads a list of MethodCalls from a YAML or JSON file
+// (selected by extension) and compiles them into a Scenario.
+func LoadScenario(path string) (*Scenario, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var calls []MethodCall
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &calls)
+	case ".json":
+		err = json.Unmarshal(data, &calls)
+	default:
+		return nil, fmt.Errorf("unsupported scenario file extension: %s", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(calls) == 0 {
+		return nil, errors.New("scenario file defines no calls")
+	}
+
+	s := &Scenario{}
+	for _, c := range calls {
+		weight := c.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+
+		kase := call(c.Name, c.Args...)
+		if c.Think != "" {
+			think, err := time.ParseDuration(c.Think)
+			if err != nil {
+				return nil, err
+			}
+			base := kase
+			kase = func(proto Protocol) error {
+				time.Sleep(think)
+				return base(proto)
+			}
+		}
+
+		s.entries = append(s.entries, scenarioEntry{name: c.Name, weight: weight, kase: kase})
+		s.totalWeight += weight
+	}
+	return s, nil
+}
+
+// Pick selects a method according to its weight and returns its name (for
+// per-method stats) alongside the Case to run.
+func (s *Scenario) Pick() (string, Case) {
+	if len(s.entries) == 1 {
+		e := s.entries[0]
+		return e.name, e.kase
+	}
+
+	r := rand.Intn(s.totalWeight)
+	for _, e := range s.entries {
+		if r < e.weight {
+			return e.name, e.kase
+		}
+		r -= e.weight
+	}
+	last := s.entries[len(s.entries)-1]
+	return last.name, last.kase
+}
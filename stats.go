@@ -0,0 +1,59 @@
+package main
+
+const (
+	microsLow  = 1                // 1 microsecond
+	microsHigh = 60 * 1000 * 1000 // 60 seconds, in microseconds
+)
+
+// stats accumulates one worker's latencies into histograms instead of a
+// slice, so recording a value is O(1) regardless of how long the run goes.
+// Each worker owns its own stats and they're merged once at the end, which
+// is what lets process/openLoopProcess run without a shared result channel.
+type stats struct {
+	service     *Histogram
+	response    *Histogram
+	byMethod    map[string]*Histogram
+	methodOrder []string
+	count       int64
+}
+
+func newStats() *stats {
+	return &stats{
+		service:  NewHistogram(microsLow, microsHigh),
+		response: NewHistogram(microsLow, microsHigh),
+		byMethod: make(map[string]*Histogram),
+	}
+}
+
+func (st *stats) record(method string, serviceMicros, responseMicros int64) {
+	st.service.RecordValue(serviceMicros)
+	st.response.RecordValue(responseMicros)
+
+	h, ok := st.byMethod[method]
+	if !ok {
+		h = NewHistogram(microsLow, microsHigh)
+		st.byMethod[method] = h
+		st.methodOrder = append(st.methodOrder, method)
+	}
+	h.RecordValue(responseMicros)
+
+	st.count++
+}
+
+// merge folds src into dst, preserving the order methods were first seen
+// in across workers.
+func (dst *stats) merge(src *stats) {
+	dst.service.Merge(src.service)
+	dst.response.Merge(src.response)
+	dst.count += src.count
+
+	for _, name := range src.methodOrder {
+		h, ok := dst.byMethod[name]
+		if !ok {
+			h = NewHistogram(microsLow, microsHigh)
+			dst.byMethod[name] = h
+			dst.methodOrder = append(dst.methodOrder, name)
+		}
+		h.Merge(src.byMethod[name])
+	}
+}
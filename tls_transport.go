@@ -0,0 +1,104 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"time"
+
+	. "github.com/stdrickforce/thriftgo/transport"
+)
+
+// tlsTransport is a Transport that dials addr over TLS, for benchmarking
+// Thrift services fronted by a TLS terminator.
+type tlsTransport struct {
+	addr   string
+	config *tls.Config
+	dialer net.Dialer
+	conn   net.Conn
+}
+
+func (t *tlsTransport) Open() (err error) {
+	t.conn, err = tls.DialWithDialer(&t.dialer, "tcp", t.addr, t.config)
+	return
+}
+
+func (t *tlsTransport) IsOpen() bool {
+	return t.conn != nil
+}
+
+func (t *tlsTransport) Close() error {
+	if t.conn == nil {
+		return nil
+	}
+	err := t.conn.Close()
+	t.conn = nil
+	return err
+}
+
+func (t *tlsTransport) Read(buf []byte) (int, error) {
+	return t.conn.Read(buf)
+}
+
+func (t *tlsTransport) Write(buf []byte) (int, error) {
+	return t.conn.Write(buf)
+}
+
+func (t *tlsTransport) Flush() error {
+	return nil
+}
+
+type tlsTransportFactory struct {
+	addr      string
+	config    *tls.Config
+	keepalive time.Duration
+}
+
+// NewTTLSSocketFactory builds transports that wrap a TCP connection to addr
+// in TLS, configured per the --tls-* flags.
+func NewTTLSSocketFactory(addr string, config *tls.Config, keepalive time.Duration) TransportFactory {
+	return &tlsTransportFactory{addr: addr, config: config, keepalive: keepalive}
+}
+
+func (f *tlsTransportFactory) GetTransport() Transport {
+	// net.Dialer treats a zero KeepAlive as "use the default"; only a
+	// negative value turns keepalive off.
+	keepalive := f.keepalive
+	if keepalive == 0 {
+		keepalive = -1
+	}
+	return &tlsTransport{addr: f.addr, config: f.config, dialer: net.Dialer{KeepAlive: keepalive}}
+}
+
+// buildTLSConfig turns the --tls-* flags into a *tls.Config, loading the
+// client certificate and CA pool if given.
+func buildTLSConfig() *tls.Config {
+	config := &tls.Config{
+		InsecureSkipVerify: *tlsInsecure,
+		ServerName:         *tlsServerName,
+	}
+
+	if *tlsCert != "" || *tlsKey != "" {
+		cert, err := tls.LoadX509KeyPair(*tlsCert, *tlsKey)
+		if err != nil {
+			panic(err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	if *tlsCA != "" {
+		pem, err := ioutil.ReadFile(*tlsCA)
+		if err != nil {
+			panic(err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			panic(fmt.Sprintf("no certificates found in %s", *tlsCA))
+		}
+		config.RootCAs = pool
+	}
+
+	return config
+}
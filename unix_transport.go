@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net"
+
+	. "github.com/stdrickforce/thriftgo/transport"
+)
+
+// unixTransport is a Transport backed by a Unix domain socket, following the
+// same Open/Close-on-demand shape as the TCP TSocket transport.
+type unixTransport struct {
+	addr string
+	conn net.Conn
+}
+
+func (t *unixTransport) Open() (err error) {
+	t.conn, err = net.Dial("unix", t.addr)
+	return
+}
+
+func (t *unixTransport) IsOpen() bool {
+	return t.conn != nil
+}
+
+func (t *unixTransport) Close() error {
+	if t.conn == nil {
+		return nil
+	}
+	err := t.conn.Close()
+	t.conn = nil
+	return err
+}
+
+func (t *unixTransport) Read(buf []byte) (int, error) {
+	return t.conn.Read(buf)
+}
+
+func (t *unixTransport) Write(buf []byte) (int, error) {
+	return t.conn.Write(buf)
+}
+
+func (t *unixTransport) Flush() error {
+	return nil
+}
+
+type unixSocketTransportFactory struct {
+	addr string
+}
+
+// NewTUnixSocketFactory builds transports that dial addr as a Unix domain
+// socket path rather than a TCP address.
+func NewTUnixSocketFactory(addr string) TransportFactory {
+	return &unixSocketTransportFactory{addr: addr}
+}
+
+func (f *unixSocketTransportFactory) GetTransport() Transport {
+	return &unixTransport{addr: f.addr}
+}